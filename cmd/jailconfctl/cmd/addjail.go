@@ -0,0 +1,42 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var addJailCmd = &cobra.Command{
+	Use:   "add-jail <file>",
+	Short: "Append the jail block(s) defined in <file> to the target config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(c *cobra.Command, args []string) error {
+		fragParser, err := parseFile(args[0])
+		if err != nil {
+			return err
+		}
+		frag, err := fragParser.ToRawConf()
+		if err != nil {
+			return err
+		}
+
+		parser, err := parseFile(confFile)
+		if err != nil {
+			return err
+		}
+		raw, err := parser.ToRawConf()
+		if err != nil {
+			return err
+		}
+
+		raw.Entries = append(raw.Entries, frag.Entries...)
+		return writeFile(confFile, raw)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addJailCmd)
+}
@@ -0,0 +1,77 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	jailconf "github.com/sadaszewski/go-jailconf"
+)
+
+func findJailBlock(conf jailconf.JailConf, name string) (jailconf.JailBlock, error) {
+	for _, e := range conf.Entries {
+		if block, ok := e.(jailconf.JailBlock); ok && block.Name == name {
+			return block, nil
+		}
+	}
+	return jailconf.JailBlock{}, fmt.Errorf("jail %q not found in %s", name, confFile)
+}
+
+func parseFile(path string) (*jailconf.JailConfParser, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parser := &jailconf.JailConfParser{Buffer: string(data), Filename: path}
+	parser.Init()
+	if err := parser.Parse(); err != nil {
+		return nil, err
+	}
+	return parser, nil
+}
+
+func writeFile(path string, conf jailconf.JailConfRaw) error {
+	b := &strings.Builder{}
+	conf.WriteTo(b)
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// render prints v (a JailBlock, JailConf or similar) in the format
+// requested via -o/--output. "raw" relies on v's own WriteTo; it is the
+// only format that makes sense for values that came straight out of
+// JailConfRaw, since json/yaml require a JailBlock/JailConf.
+func render(format string, v interface{}) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "yaml":
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+	case "raw":
+		w, ok := v.(interface{ WriteTo(io.Writer) })
+		if !ok {
+			return fmt.Errorf("value does not support raw rendering, use -o json or -o yaml")
+		}
+		w.WriteTo(os.Stdout)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	return nil
+}
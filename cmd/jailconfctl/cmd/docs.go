@@ -0,0 +1,35 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+var docsDir string
+
+// gen-docs is hidden: it's a packaging-time tool, not something an
+// operator running jailconfctl day to day needs to see in --help.
+var genDocsCmd = &cobra.Command{
+	Use:    "gen-docs",
+	Short:  "Generate man pages for jailconfctl",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(c *cobra.Command, args []string) error {
+		header := &doc.GenManHeader{
+			Title:   "JAILCONFCTL",
+			Section: "1",
+		}
+		return doc.GenManTree(rootCmd, header, docsDir)
+	},
+}
+
+func init() {
+	genDocsCmd.Flags().StringVar(&docsDir, "dir", ".", "directory to write man pages into")
+	rootCmd.AddCommand(genDocsCmd)
+	rootCmd.CompletionOptions.DisableDefaultCmd = false
+}
@@ -0,0 +1,46 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	jailconf "github.com/sadaszewski/go-jailconf"
+)
+
+var (
+	sortKeys    bool
+	alignEquals bool
+)
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt",
+	Short: "Re-emit the config file in canonical form",
+	Args:  cobra.NoArgs,
+	RunE: func(c *cobra.Command, args []string) error {
+		parser, err := parseFile(confFile)
+		if err != nil {
+			return err
+		}
+		conf, err := parser.ToStruct()
+		if err != nil {
+			return err
+		}
+		fmt.Print(jailconf.Format(conf, jailconf.FormatOptions{
+			SortKeys:    sortKeys,
+			AlignEquals: alignEquals,
+		}))
+		return nil
+	},
+}
+
+func init() {
+	fmtCmd.Flags().BoolVar(&sortKeys, "sort-keys", false, "sort keys within each jail block")
+	fmtCmd.Flags().BoolVar(&alignEquals, "align-equals", false, "align '=' across keys within each jail block")
+	rootCmd.AddCommand(fmtCmd)
+}
@@ -0,0 +1,51 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get <jail> [<key>]",
+	Short: "Print a jail block, or a single key within it",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(c *cobra.Command, args []string) error {
+		parser, err := parseFile(confFile)
+		if err != nil {
+			return err
+		}
+		conf, err := parser.ToStruct()
+		if err != nil {
+			return err
+		}
+
+		block, err := findJailBlock(conf, args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			return render(output, block)
+		}
+
+		value, ok := block.Get(args[1])
+		if !ok {
+			return fmt.Errorf("jail %q has no key %q", args[0], args[1])
+		}
+		if output == "raw" {
+			fmt.Println(value.Sprint())
+			return nil
+		}
+		return render(output, value)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+}
@@ -0,0 +1,42 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var rmCmd = &cobra.Command{
+	Use:   "rm <jail>",
+	Short: "Remove a jail block",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(c *cobra.Command, args []string) error {
+		parser, err := parseFile(confFile)
+		if err != nil {
+			return err
+		}
+		raw, err := parser.ToRawConf()
+		if err != nil {
+			return err
+		}
+
+		raw, removed, err := parser.RemoveJailBlock(raw, args[0])
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("jail %q not found in %s", args[0], confFile)
+		}
+
+		return writeFile(confFile, raw)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+}
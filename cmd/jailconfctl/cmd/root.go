@@ -0,0 +1,38 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	confFile string
+	output   string
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "jailconfctl",
+	Short: "Query and mutate FreeBSD jail.conf files",
+	Long: `jailconfctl reads and edits jail.conf files without disturbing the
+formatting of everything it doesn't touch.`,
+}
+
+// Execute runs the root command, exiting the process on error.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&confFile, "file", "f", "/etc/jail.conf", "path to the jail.conf file to operate on")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", "raw", "output format: json|yaml|raw")
+}
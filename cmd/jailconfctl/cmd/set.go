@@ -0,0 +1,68 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	jailconf "github.com/sadaszewski/go-jailconf"
+)
+
+var appendValue bool
+
+var setCmd = &cobra.Command{
+	Use:   "set <jail> <key> <value>",
+	Short: "Set (or append to) a key in a jail block",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(c *cobra.Command, args []string) error {
+		jailName, key, value := args[0], args[1], args[2]
+
+		parser, err := parseFile(confFile)
+		if err != nil {
+			return err
+		}
+		raw, err := parser.ToRawConf()
+		if err != nil {
+			return err
+		}
+
+		i, block, err := parser.FindJailBlockRaw(raw, jailName)
+		if err != nil {
+			return err
+		}
+
+		newValue := jailconf.JailValue{Items: strings.Split(value, ",")}
+		b := &strings.Builder{}
+		if appendValue {
+			jailconf.JailKeyValueAppendPair{Key: key, Value: newValue}.WriteTo(b)
+			block.Entries = append(block.Entries, jailconf.JailEntryRaw{Text: "  " + b.String()})
+		} else {
+			jailconf.JailKeyValuePair{Key: key, Value: newValue}.WriteTo(b)
+			text := "  " + b.String()
+			replaced := false
+			for j, e := range block.Entries {
+				if k, ok := parser.EntryKey(e); ok && k == key {
+					block.Entries[j].Text = text
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				block.Entries = append(block.Entries, jailconf.JailEntryRaw{Text: text})
+			}
+		}
+		raw.Entries[i] = block
+
+		return writeFile(confFile, raw)
+	},
+}
+
+func init() {
+	setCmd.Flags().BoolVar(&appendValue, "append", false, "append to the existing value instead of replacing it")
+	rootCmd.AddCommand(setCmd)
+}
@@ -0,0 +1,59 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	jailconf "github.com/sadaszewski/go-jailconf"
+)
+
+var (
+	strictValidate   bool
+	pedanticValidate bool
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check that the config file parses and its parameters are known",
+	Args:  cobra.NoArgs,
+	RunE: func(c *cobra.Command, args []string) error {
+		parser, err := parseFile(confFile)
+		if err != nil {
+			return err
+		}
+		conf, err := parser.ToStruct()
+		if err != nil {
+			return err
+		}
+
+		v := jailconf.NewValidator()
+		v.Strict = strictValidate
+		v.Pedantic = pedanticValidate
+		diags := v.Validate(conf)
+
+		hasError := false
+		for _, d := range diags {
+			fmt.Println(d)
+			if d.Severity == jailconf.SeverityError {
+				hasError = true
+			}
+		}
+		if hasError {
+			return fmt.Errorf("%s: validation failed", confFile)
+		}
+		fmt.Printf("%s: ok\n", confFile)
+		return nil
+	},
+}
+
+func init() {
+	validateCmd.Flags().BoolVar(&strictValidate, "strict", false, "reject unknown parameters")
+	validateCmd.Flags().BoolVar(&pedanticValidate, "pedantic", false, "warn on deprecated parameters")
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,14 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package main
+
+import (
+	"github.com/sadaszewski/go-jailconf/cmd/jailconfctl/cmd"
+)
+
+func main() {
+	cmd.Execute()
+}
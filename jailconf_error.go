@@ -0,0 +1,78 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a failure encountered while walking the jail.conf
+// syntax tree, with enough source position information to render a
+// clang-style diagnostic instead of crashing the caller.
+type ParseError struct {
+	Filename string
+	Line     int
+	Col      int
+	Snippet  string
+	Rule     string
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	loc := fmt.Sprintf("%d:%d", e.Line, e.Col)
+	if e.Filename != "" {
+		loc = e.Filename + ":" + loc
+	}
+	return fmt.Sprintf("%s: %s (rule: %s)\n%s", loc, e.Message, e.Rule, e.Snippet)
+}
+
+// newParseError builds a ParseError for node, deriving line/column/snippet
+// from its begin offset in parser.Buffer and filename from parser.Filename,
+// if the caller set one.
+func (parser *JailConfParser) newParseError(node *node32, message string) *ParseError {
+	line, col, snippet := parser.position(node.begin)
+	return &ParseError{
+		Filename: parser.Filename,
+		Line:     line,
+		Col:      col,
+		Snippet:  snippet,
+		Rule:     rul3s[node.pegRule],
+		Message:  message,
+	}
+}
+
+// position computes the 1-based line/column of offset within parser.Buffer,
+// along with the full text of the line it falls on.
+func (parser *JailConfParser) position(offset int) (line int, col int, snippet string) {
+	line = 1
+	lineStart := 0
+	for i := 0; i < offset && i < len(parser.Buffer); i++ {
+		if parser.Buffer[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+	col = offset - lineStart + 1
+	lineEnd := strings.IndexByte(parser.Buffer[lineStart:], '\n')
+	if lineEnd == -1 {
+		snippet = parser.Buffer[lineStart:]
+	} else {
+		snippet = parser.Buffer[lineStart : lineStart+lineEnd]
+	}
+	return
+}
+
+// pos captures node's source location as a Pos, for entries that keep
+// their position around (see JailEntry).
+func (parser *JailConfParser) pos(node *node32) Pos {
+	line, col, _ := parser.position(node.begin)
+	return Pos{Begin: node.begin, End: node.end, Line: line, Col: col}
+}
+
+func unexpectedRuleError(parser *JailConfParser, node *node32, expected string) error {
+	return parser.newParseError(node, fmt.Sprintf("expected %s, got %s", expected, rul3s[node.pegRule]))
+}
@@ -0,0 +1,139 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import (
+	"sort"
+	"strings"
+)
+
+// FormatOptions controls how Format re-emits a JailConf.
+type FormatOptions struct {
+	// Indent prefixes every line inside a jail block. Defaults to two
+	// spaces, matching JailBlock.WriteTo, if left empty.
+	Indent string
+	// AlignEquals pads keys within a block so their '=' / '+=' line up.
+	AlignEquals bool
+	// SortKeys orders key/value statements within a block alphabetically
+	// by key. Each comment moves with the statement that follows it and
+	// stays immediately ahead of it; comments after the last statement of
+	// a block stay at the end.
+	SortKeys bool
+}
+
+// Format re-emits conf as jail.conf syntax, deterministically: with
+// SortKeys, the statements within each jail block come out in key order
+// regardless of what order they were added or parsed in, which is what
+// makes it useful for `jailconfctl fmt` and for diffing configs under
+// version control. Jail blocks and other top-level entries keep their
+// order. Comments and other non-block top-level entries are passed
+// through unchanged.
+func Format(conf JailConf, opts FormatOptions) string {
+	if opts.Indent == "" {
+		opts.Indent = "  "
+	}
+
+	b := &strings.Builder{}
+	for _, e := range conf.Entries {
+		if jblk, ok := e.(JailBlock); ok {
+			formatBlock(b, jblk, opts)
+			continue
+		}
+		e.WriteTo(b)
+	}
+	return b.String()
+}
+
+func formatBlock(b *strings.Builder, jblk JailBlock, opts FormatOptions) {
+	entries := jblk.Entries
+	if opts.SortKeys {
+		entries = sortEntries(entries)
+	}
+
+	width := 0
+	if opts.AlignEquals {
+		for _, e := range entries {
+			if k := entryKey(e); len(k) > width {
+				width = len(k)
+			}
+		}
+	}
+
+	b.WriteString(EscapeString(jblk.Name))
+	b.WriteString(" {\n")
+	for _, e := range entries {
+		b.WriteString(opts.Indent)
+		writeEntry(b, e, width)
+	}
+	b.WriteString("}\n")
+}
+
+// entryKey returns the sort/alignment key for e, or "" for entries (like
+// comments) that have none.
+func entryKey(e JailEntry) string {
+	switch entry := e.(type) {
+	case JailKeyValuePair:
+		return entry.Key
+	case JailKeyValueAppendPair:
+		return entry.Key
+	case JailKeySet:
+		return entry.Key
+	default:
+		return ""
+	}
+}
+
+// entryLast sorts after any real key, so a comment with no following
+// statement (e.g. one trailing the last key in a block) sorts to the end
+// instead of floating to the front like an empty key would.
+const entryLast = "\xff"
+
+// sortEntries orders entries alphabetically by entryKey, anchoring each
+// comment to the key of the next key/value statement that follows it so it
+// stays immediately ahead of that statement rather than sorting ahead of
+// every statement in the block.
+func sortEntries(entries []JailEntry) []JailEntry {
+	type keyed struct {
+		key   string
+		entry JailEntry
+	}
+	keyedEntries := make([]keyed, len(entries))
+	next := entryLast
+	for i := len(entries) - 1; i >= 0; i-- {
+		if k := entryKey(entries[i]); k != "" {
+			next = k
+		}
+		keyedEntries[i] = keyed{key: next, entry: entries[i]}
+	}
+	sort.SliceStable(keyedEntries, func(i, j int) bool {
+		return keyedEntries[i].key < keyedEntries[j].key
+	})
+	sorted := make([]JailEntry, len(keyedEntries))
+	for i, ke := range keyedEntries {
+		sorted[i] = ke.entry
+	}
+	return sorted
+}
+
+func writeEntry(b *strings.Builder, e JailEntry, width int) {
+	var key, op string
+	var value JailValue
+	switch entry := e.(type) {
+	case JailKeyValuePair:
+		key, op, value = entry.Key, " = ", entry.Value
+	case JailKeyValueAppendPair:
+		key, op, value = entry.Key, " += ", entry.Value
+	}
+	if op == "" || width == 0 {
+		e.WriteTo(b)
+		return
+	}
+	b.WriteString(key)
+	b.WriteString(strings.Repeat(" ", width-len(key)))
+	b.WriteString(op)
+	b.WriteString(value.Sprint())
+	b.WriteString(";\n")
+}
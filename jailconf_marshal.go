@@ -0,0 +1,313 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Marshal encodes v, which must be a struct or a pointer to one, into jail.conf
+// syntax. Top-level fields become jail blocks named after the field's
+// `jailconf` tag (or the field name if no tag is present); fields of a
+// jail block map to key/value pairs the same way.
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("jailconf: Marshal expects a struct or pointer to struct, got %s", rv.Kind())
+	}
+
+	b := &strings.Builder{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, opts := parseTag(field.Tag.Get("jailconf"))
+		if name == "-" {
+			continue
+		}
+		if opts.has("raw") {
+			// JailConfRaw's entries are JailTypeRaw, not the JailType the
+			// rest of this loop deals in, so write them out directly
+			// instead of trying to splice them into a shared JailConf.
+			if raw, ok := rv.Field(i).Interface().(JailConfRaw); ok {
+				raw.WriteTo(b)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		jblk, err := marshalBlock(name, rv.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		jblk.WriteTo(b)
+	}
+
+	return []byte(b.String()), nil
+}
+
+func marshalBlock(name string, rv reflect.Value) (JailBlock, error) {
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return JailBlock{}, fmt.Errorf("jailconf: jail block field %q must be a struct, got %s", name, rv.Kind())
+	}
+
+	jblk := NewJailBlock()
+	jblk.Name = name
+	if err := marshalFields(&jblk, rv); err != nil {
+		return JailBlock{}, err
+	}
+	return jblk, nil
+}
+
+func marshalFields(jblk *JailBlock, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, opts := parseTag(field.Tag.Get("jailconf"))
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if opts.has("inline") {
+			inner := fv
+			if inner.Kind() == reflect.Ptr {
+				inner = inner.Elem()
+			}
+			if inner.Kind() != reflect.Struct {
+				return fmt.Errorf("jailconf: inline field %q must be a struct", field.Name)
+			}
+			if err := marshalFields(jblk, inner); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value, err := marshalValue(fv)
+		if err != nil {
+			return fmt.Errorf("jailconf: field %q: %w", field.Name, err)
+		}
+		if opts.has("append") {
+			jblk.Entries = append(jblk.Entries, JailKeyValueAppendPair{Key: name, Value: value})
+		} else {
+			jblk.Set(name, value)
+		}
+	}
+	return nil
+}
+
+func marshalValue(fv reflect.Value) (JailValue, error) {
+	switch fv.Kind() {
+	case reflect.String:
+		return JailValueFromString(fv.String()), nil
+	case reflect.Bool:
+		return JailValueFromString(strconv.FormatBool(fv.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return JailValueFromString(strconv.FormatInt(fv.Int(), 10)), nil
+	case reflect.Slice:
+		res := JailValue{}
+		for i := 0; i < fv.Len(); i++ {
+			v, err := marshalValue(fv.Index(i))
+			if err != nil {
+				return JailValue{}, err
+			}
+			res.Items = append(res.Items, v.Items...)
+		}
+		return res, nil
+	default:
+		return JailValue{}, fmt.Errorf("unsupported kind %s", fv.Kind())
+	}
+}
+
+// Unmarshal parses data as jail.conf syntax and stores the result in v,
+// which must be a pointer to a struct. Comments and `.include` directives
+// that are not captured by a struct field are preserved verbatim in a
+// field tagged `jailconf:",raw"`, if one is present, so that re-marshaling
+// round-trips them.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("jailconf: Unmarshal expects a pointer to struct")
+	}
+	rv = rv.Elem()
+
+	parser := &JailConfParser{Buffer: string(data)}
+	parser.Init()
+	if err := parser.Parse(); err != nil {
+		return err
+	}
+	raw, err := parser.ToRawConf()
+	if err != nil {
+		return err
+	}
+
+	rt := rv.Type()
+	fieldByName := make(map[string]int)
+	var rawField = -1
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, opts := parseTag(field.Tag.Get("jailconf"))
+		if opts.has("raw") {
+			rawField = i
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fieldByName[name] = i
+	}
+
+	var leftover JailConfRaw
+	for _, e := range raw.Entries {
+		jblkRaw, ok := e.(JailBlockRaw)
+		if !ok {
+			leftover.Entries = append(leftover.Entries, e)
+			continue
+		}
+		jblk, err := parser.ToBlock(jblkRaw)
+		if err != nil {
+			return err
+		}
+		i, ok := fieldByName[jblk.Name]
+		if !ok {
+			leftover.Entries = append(leftover.Entries, e)
+			continue
+		}
+		if err := unmarshalBlock(jblk, rv.Field(i)); err != nil {
+			return fmt.Errorf("jailconf: jail %q: %w", jblk.Name, err)
+		}
+	}
+
+	if rawField >= 0 {
+		rv.Field(rawField).Set(reflect.ValueOf(leftover))
+	}
+	return nil
+}
+
+func unmarshalBlock(jblk JailBlock, rv reflect.Value) error {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	return unmarshalFields(jblk, rv)
+}
+
+func unmarshalFields(jblk JailBlock, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, opts := parseTag(field.Tag.Get("jailconf"))
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if opts.has("inline") {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := unmarshalFields(jblk, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value, ok := jblk.Get(name)
+		if !ok {
+			continue
+		}
+		if err := unmarshalValue(value, fv); err != nil {
+			return fmt.Errorf("field %q: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func unmarshalValue(value JailValue, fv reflect.Value) error {
+	switch fv.Kind() {
+	case reflect.String:
+		item, err := value.Item()
+		if err != nil {
+			return err
+		}
+		fv.SetString(item)
+	case reflect.Bool:
+		item, err := value.Item()
+		if err != nil {
+			return err
+		}
+		b, err := strconv.ParseBool(item)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		item, err := value.Item()
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Slice:
+		elems := reflect.MakeSlice(fv.Type(), len(value.Items), len(value.Items))
+		for i, item := range value.Items {
+			if err := unmarshalValue(JailValueFromString(item), elems.Index(i)); err != nil {
+				return err
+			}
+		}
+		fv.Set(elems)
+	default:
+		return fmt.Errorf("unsupported kind %s", fv.Kind())
+	}
+	return nil
+}
+
+type tagOptions []string
+
+func (opts tagOptions) has(opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTag(tag string) (string, tagOptions) {
+	parts := strings.Split(tag, ",")
+	return parts[0], tagOptions(parts[1:])
+}
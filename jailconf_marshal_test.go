@@ -0,0 +1,62 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testJail struct {
+	Path    string   `jailconf:"path"`
+	Persist bool     `jailconf:"persist"`
+	IPAddrs []string `jailconf:"ip4.addr"`
+}
+
+type testConf struct {
+	Foo testJail `jailconf:"foo"`
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	in := testConf{
+		Foo: testJail{
+			Path:    "/jails/foo",
+			Persist: true,
+			IPAddrs: []string{"10.0.0.1", "10.0.0.2"},
+		},
+	}
+
+	data, err := Marshal(&in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var out testConf
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", out, in)
+	}
+}
+
+func TestMarshalWithRawSidecar(t *testing.T) {
+	type confWithRaw struct {
+		Foo testJail    `jailconf:"foo"`
+		Raw JailConfRaw `jailconf:",raw"`
+	}
+
+	in := confWithRaw{Foo: testJail{Path: "/jails/foo"}}
+
+	data, err := Marshal(&in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if len(data) == 0 {
+		t.Fatalf("Marshal produced no output")
+	}
+}
@@ -1,180 +1,215 @@
-//
-// Copyright (C) 2021, Stanislaw Adaszewski
-// See LICENSE for terms
-//
-
-package main
-
-import (
-	"io"
-	"io/ioutil"
-	"log"
-	"os"
-	"strings"
-	"github.com/go-errors/errors"
-)
-
-type JailTypeRaw interface {
-	GetNode() *node32
-	WriteTo(io.Writer)
-}
-
-type JailEntryRaw struct {
-	Node *node32
-	Text string
-}
-
-type JailConfRaw struct {
-	Entries []JailTypeRaw
-}
-
-type JailBlockRaw struct {
-	Node *node32
-	Entries []JailEntryRaw
-}
-
-func (entry JailEntryRaw) GetNode() *node32 {
-	return entry.Node
-}
-
-func (jblk JailBlockRaw) GetNode() *node32 {
-	return jblk.Node
-}
-
-func (conf JailConfRaw) WriteTo(w io.Writer) {
-	for _, e := range conf.Entries {
-		e.WriteTo(w)
-	}
-}
-
-func (entry JailEntryRaw) WriteTo(w io.Writer) {
-	io.WriteString(w, entry.Text)
-}
-
-func (parser *JailConfParser) GetJailBlock(conf JailConfRaw, name string) (JailBlock, error) {
-	for _, e := range conf.Entries {
-		switch e.(type) {
-		case JailBlockRaw:
-			res := parser.ToBlock(e.(JailBlockRaw))
-			if res.Name == name {
-				return res, nil
-			}
-		}
-	}
-	return JailBlock{}, errors.New("Jail not found")
-}
-
-func (parser *JailConfParser) RemoveJailBlock(conf JailConfRaw, name string) (JailConfRaw, bool) {
-	res := JailConfRaw{}
-	wasRemoved := false
-	for _, e := range conf.Entries {
-		switch e.(type) {
-		case JailBlockRaw:
-			jblk := parser.ToBlock(e.(JailBlockRaw))
-			if jblk.Name == name {
-				wasRemoved = true
-				continue
-			} else {
-				res.Entries = append(res.Entries, e)
-			}
-		default:
-			res.Entries = append(res.Entries, e)
-		}
-	}
-	return res, wasRemoved
-}
-
-func (jblk JailBlockRaw) WriteTo(w io.Writer) {
-	for _, e := range jblk.Entries {
-		e.WriteTo(w)
-	}
-}
-
-func (parser *JailConfParser) ToBlock(jblk JailBlockRaw) JailBlock {
-	res := parser.HandleJailBlock(jblk.Node)
-	return res
-}
-
-func (parser *JailConfParser) ToRawConf() JailConfRaw {
-	return parser.HandleTopRaw(parser.AST())
-}
-
-func (parser *JailConfParser) HandleTopRaw(node *node32) JailConfRaw {
-	if (node.pegRule != ruletop) {
-		panic("Expected top")
-	}
-	node = node.up
-	res := JailConfRaw{}
-	for node != nil {
-		switch node.pegRule {
-		case rulejail_block:
-			res.Entries = append(res.Entries,
-				parser.HandleJailBlockRaw(node))
-		default:
-			res.Entries = append(res.Entries,
-				JailEntryRaw{Node: node,
-					Text: parser.Buffer[node.begin:node.end]})
-		}
-		node = node.next
-	}
-	return res
-}
-
-func (parser *JailConfParser) HandleJailBlockRaw(node *node32) JailBlockRaw {
-	if (node.pegRule != rulejail_block) {
-		panic("Expected jail block")
-	}
-	res := JailBlockRaw{ Node: node }
-	node = node.up
-	for node != nil {
-		res.Entries = append(res.Entries,
-			JailEntryRaw{Node: node,
-				Text: parser.Buffer[node.begin:node.end]})
-		node = node.next
-	}
-	return res
-}
-
-func (jblk JailBlock) ToRaw() JailBlockRaw {
-	res := JailBlockRaw{}
-	res.Entries = append(res.Entries, JailEntryRaw{ Text: "\n" + jblk.Name + " {\n" })
-	b := &strings.Builder{}
-	for k, v := range jblk.KeyValuePairs {
-		b.Reset()
-		b.WriteString("  ")
-		JailKeyValuePair{ Key: k, Value: v }.WriteTo(b)
-		res.Entries = append(res.Entries, JailEntryRaw{ Text: b.String() })
-	}
-	res.Entries = append(res.Entries, JailEntryRaw{ Text: "}\n" })
-	return res
-}
-
-func main() {
-	expr, err := ioutil.ReadFile("samplejail.conf");
-	if err != nil {
-		log.Fatal(err)
-	}
-	// log.Println(string(expr))
-	parser := &JailConfParser{Buffer: string(expr)}
-	parser.Init()
-	if err := parser.Parse(); err != nil {
-		log.Fatal(err)
-	}
-	conf := parser.ToRawConf()
-	// conf.WriteTo(os.Stdout)
-	var jblk JailBlock
-	if jblk, err = parser.GetJailBlock(conf, "foo"); err != nil {
-		log.Fatal(err)
-	}
-	jblk.WriteTo(os.Stdout)
-
-	//conf, _ = parser.RemoveJailBlock(conf, "foo")
-
-	newJail := JailBlock{ Name: "lorem", KeyValuePairs: map[string]JailValue{
-		"foo": JailValueFromString("bar"),
-		"allow.mount": JailValueFromString("true"),
-	} }
-	conf.Entries = append(conf.Entries, newJail.ToRaw())
-
-	//conf.WriteTo(os.Stdout)
-}
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import (
+	"io"
+	"strings"
+	"github.com/go-errors/errors"
+)
+
+type JailTypeRaw interface {
+	GetNode() *node32
+	WriteTo(io.Writer)
+}
+
+type JailEntryRaw struct {
+	Node *node32
+	Text string
+}
+
+type JailConfRaw struct {
+	Entries []JailTypeRaw
+}
+
+type JailBlockRaw struct {
+	Node *node32
+	Entries []JailEntryRaw
+}
+
+func (entry JailEntryRaw) GetNode() *node32 {
+	return entry.Node
+}
+
+func (jblk JailBlockRaw) GetNode() *node32 {
+	return jblk.Node
+}
+
+func (conf JailConfRaw) WriteTo(w io.Writer) {
+	for _, e := range conf.Entries {
+		e.WriteTo(w)
+	}
+}
+
+func (entry JailEntryRaw) WriteTo(w io.Writer) {
+	io.WriteString(w, entry.Text)
+}
+
+func (parser *JailConfParser) GetJailBlock(conf JailConfRaw, name string) (JailBlock, error) {
+	for _, e := range conf.Entries {
+		switch e.(type) {
+		case JailBlockRaw:
+			res, err := parser.ToBlock(e.(JailBlockRaw))
+			if err != nil {
+				return JailBlock{}, err
+			}
+			if res.Name == name {
+				return res, nil
+			}
+		}
+	}
+	return JailBlock{}, errors.New("Jail not found")
+}
+
+func (parser *JailConfParser) RemoveJailBlock(conf JailConfRaw, name string) (JailConfRaw, bool, error) {
+	res := JailConfRaw{}
+	wasRemoved := false
+	for _, e := range conf.Entries {
+		switch e.(type) {
+		case JailBlockRaw:
+			jblk, err := parser.ToBlock(e.(JailBlockRaw))
+			if err != nil {
+				return JailConfRaw{}, false, err
+			}
+			if jblk.Name == name {
+				wasRemoved = true
+				continue
+			} else {
+				res.Entries = append(res.Entries, e)
+			}
+		default:
+			res.Entries = append(res.Entries, e)
+		}
+	}
+	return res, wasRemoved, nil
+}
+
+func (jblk JailBlockRaw) WriteTo(w io.Writer) {
+	for _, e := range jblk.Entries {
+		e.WriteTo(w)
+	}
+}
+
+func (parser *JailConfParser) ToBlock(jblk JailBlockRaw) (JailBlock, error) {
+	return parser.HandleJailBlock(jblk.Node)
+}
+
+// FindJailBlockRaw returns the index and raw form of the jail block named
+// name within conf. Unlike GetJailBlock, the index lets a caller patch
+// individual JailEntryRaw.Text fields and splice the block back into conf
+// in place, instead of rebuilding the whole block (and losing its original
+// formatting) through JailBlock/ToRaw.
+func (parser *JailConfParser) FindJailBlockRaw(conf JailConfRaw, name string) (int, JailBlockRaw, error) {
+	for i, e := range conf.Entries {
+		jblkRaw, ok := e.(JailBlockRaw)
+		if !ok {
+			continue
+		}
+		jblk, err := parser.ToBlock(jblkRaw)
+		if err != nil {
+			return -1, JailBlockRaw{}, err
+		}
+		if jblk.Name == name {
+			return i, jblkRaw, nil
+		}
+	}
+	return -1, JailBlockRaw{}, errors.New("Jail not found")
+}
+
+// EntryKey returns the key carried by a key_value_pair, key_value_append_pair
+// or key_set raw entry, and whether entry is one of those shapes. A key_set
+// key is returned with any "no" negation removed, as GetKeySetValue does
+// (`allow.nomount;` yields "allow.mount"). Callers
+// use it to find the specific JailEntryRaw backing a key without going
+// through the lossy JailBlock/ToRaw round trip.
+func (parser *JailConfParser) EntryKey(entry JailEntryRaw) (string, bool) {
+	if entry.Node == nil {
+		return "", false
+	}
+	switch entry.Node.pegRule {
+	case rulekey_value_pair:
+		kvp, err := parser.HandleKeyValuePair(entry.Node)
+		if err != nil {
+			return "", false
+		}
+		return kvp.Key, true
+	case rulekey_value_append_pair:
+		kvp, err := parser.HandleKeyValueAppendPair(entry.Node)
+		if err != nil {
+			return "", false
+		}
+		return kvp.Key, true
+	case rulekey_set:
+		ks, err := parser.HandleKeySet(entry.Node)
+		if err != nil {
+			return "", false
+		}
+		key, _ := GetKeySetValue(ks.Key)
+		return key, true
+	}
+	return "", false
+}
+
+// ToRawConf walks the parsed syntax tree the same way ToStruct does, but
+// keeps non-block entries (comments, includes, top-level key/value pairs)
+// as verbatim text so that a later WriteTo reproduces the original
+// formatting exactly.
+func (parser *JailConfParser) ToRawConf() (JailConfRaw, error) {
+	return parser.HandleTopRaw(parser.AST())
+}
+
+func (parser *JailConfParser) HandleTopRaw(node *node32) (JailConfRaw, error) {
+	if (node.pegRule != ruletop) {
+		return JailConfRaw{}, unexpectedRuleError(parser, node, "top expression")
+	}
+	node = node.up
+	res := JailConfRaw{}
+	for node != nil {
+		switch node.pegRule {
+		case rulejail_block:
+			jblk, err := parser.HandleJailBlockRaw(node)
+			if err != nil {
+				return JailConfRaw{}, err
+			}
+			res.Entries = append(res.Entries, jblk)
+		default:
+			res.Entries = append(res.Entries,
+				JailEntryRaw{Node: node,
+					Text: parser.Buffer[node.begin:node.end]})
+		}
+		node = node.next
+	}
+	return res, nil
+}
+
+func (parser *JailConfParser) HandleJailBlockRaw(node *node32) (JailBlockRaw, error) {
+	if (node.pegRule != rulejail_block) {
+		return JailBlockRaw{}, unexpectedRuleError(parser, node, "jail block")
+	}
+	res := JailBlockRaw{ Node: node }
+	node = node.up
+	for node != nil {
+		res.Entries = append(res.Entries,
+			JailEntryRaw{Node: node,
+				Text: parser.Buffer[node.begin:node.end]})
+		node = node.next
+	}
+	return res, nil
+}
+
+func (jblk JailBlock) ToRaw() JailBlockRaw {
+	res := JailBlockRaw{}
+	res.Entries = append(res.Entries, JailEntryRaw{ Text: "\n" + jblk.Name + " {\n" })
+	b := &strings.Builder{}
+	for _, e := range jblk.Entries {
+		b.Reset()
+		b.WriteString("  ")
+		e.WriteTo(b)
+		res.Entries = append(res.Entries, JailEntryRaw{ Text: b.String() })
+	}
+	res.Entries = append(res.Entries, JailEntryRaw{ Text: "}\n" })
+	return res
+}
@@ -0,0 +1,250 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ParamType is the Go-level type a jail(8) parameter's value must parse
+// as.
+type ParamType int
+
+const (
+	ParamBool ParamType = iota
+	ParamInt
+	ParamString
+	ParamIPAddr
+	ParamPathList
+)
+
+// ParamSpec describes one jail(8) parameter: its value type, whether it
+// may carry more than one value (a list_of_values or repeated += lines),
+// and whether it is deprecated.
+type ParamSpec struct {
+	Type      ParamType
+	AllowList bool
+	// Deprecated names the replacement parameter, or is empty if this one
+	// isn't deprecated.
+	Deprecated string
+	// DeprecatedInVnet narrows Deprecated so it's only reported inside a
+	// jail block that sets vnet; e.g. ip4/ip6 are the normal, correct way
+	// to address an ordinary jail, and only redundant once vnet gives the
+	// jail its own network stack.
+	DeprecatedInVnet bool
+}
+
+// Severity classifies a Diagnostic.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic reports a single problem found by Validator.Validate.
+type Diagnostic struct {
+	Jail     string
+	Key      string
+	Line     int
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s.%s: %s", d.Severity, d.Line, d.Jail, d.Key, d.Message)
+}
+
+// Validator checks a JailConf against the set of known jail(8) parameters.
+// In Strict mode, keys it doesn't recognize are reported as errors; in
+// Pedantic mode, keys it knows to be deprecated are reported as warnings.
+// Use RegisterParam to teach it about parameters it doesn't ship with,
+// e.g. ones added by a third-party kernel module.
+type Validator struct {
+	Strict   bool
+	Pedantic bool
+
+	params map[string]ParamSpec
+}
+
+// NewValidator returns a Validator pre-loaded with the jail(8) parameters
+// shipped with stock FreeBSD.
+func NewValidator() *Validator {
+	v := &Validator{params: make(map[string]ParamSpec, len(defaultParams))}
+	for name, spec := range defaultParams {
+		v.params[name] = spec
+	}
+	return v
+}
+
+// RegisterParam adds or overrides the spec for a parameter name.
+func (v *Validator) RegisterParam(name string, spec ParamSpec) {
+	v.params[name] = spec
+}
+
+// Validate checks every key in every jail block of conf against the known
+// parameter set, returning one Diagnostic per problem found. It walks
+// block.Entries rather than the flattened block.Values() so each Diagnostic
+// can carry the source line of the statement it came from.
+func (v *Validator) Validate(conf JailConf) []Diagnostic {
+	var diags []Diagnostic
+	for _, e := range conf.Entries {
+		block, ok := e.(JailBlock)
+		if !ok {
+			continue
+		}
+		vnet := blockVnetEnabled(block)
+		assigned := make(map[string]bool)
+		for _, entry := range block.Entries {
+			switch kv := entry.(type) {
+			case JailKeyValuePair:
+				diags = append(diags, v.validateKey(block.Name, kv.Key, kv.Value, kv.Pos.Line, vnet)...)
+				assigned[kv.Key] = true
+			case JailKeyValueAppendPair:
+				diags = append(diags, v.validateKey(block.Name, kv.Key, kv.Value, kv.Pos.Line, vnet)...)
+				if spec, known := v.params[kv.Key]; known && !spec.AllowList && assigned[kv.Key] && len(kv.Value.Items) <= 1 {
+					diags = append(diags, Diagnostic{
+						Jail: block.Name, Key: kv.Key, Line: kv.Pos.Line, Severity: SeverityError,
+						Message: "multiple values are not permitted for this parameter",
+					})
+				}
+				assigned[kv.Key] = true
+			case JailKeySet:
+				key, value := GetKeySetValue(kv.Key)
+				diags = append(diags, v.validateKey(block.Name, key, JailValueFromString(value), kv.Pos.Line, vnet)...)
+			}
+		}
+	}
+	return diags
+}
+
+// blockVnetEnabled reports whether block's effective vnet value is true, so
+// validateKey can tell whether parameters like ip4/ip6 are actually
+// redundant instead of flagging them unconditionally.
+func blockVnetEnabled(block JailBlock) bool {
+	value, ok := block.Get("vnet")
+	if !ok {
+		return false
+	}
+	item, err := value.Item()
+	if err != nil {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(item)
+	return enabled
+}
+
+func (v *Validator) validateKey(jail, key string, value JailValue, line int, vnet bool) []Diagnostic {
+	spec, known := v.params[key]
+	if !known {
+		if v.Strict {
+			return []Diagnostic{{Jail: jail, Key: key, Line: line, Severity: SeverityError, Message: "unknown parameter"}}
+		}
+		return nil
+	}
+
+	var diags []Diagnostic
+	if v.Pedantic && spec.Deprecated != "" && (!spec.DeprecatedInVnet || vnet) {
+		diags = append(diags, Diagnostic{
+			Jail: jail, Key: key, Line: line, Severity: SeverityWarning,
+			Message: fmt.Sprintf("deprecated, use %s instead", spec.Deprecated),
+		})
+	}
+	if len(value.Items) > 1 && !spec.AllowList {
+		diags = append(diags, Diagnostic{
+			Jail: jail, Key: key, Line: line, Severity: SeverityError,
+			Message: "multiple values are not permitted for this parameter",
+		})
+	}
+	for _, item := range value.Items {
+		if err := spec.Type.check(item); err != nil {
+			diags = append(diags, Diagnostic{Jail: jail, Key: key, Line: line, Severity: SeverityError, Message: err.Error()})
+		}
+	}
+	return diags
+}
+
+func (t ParamType) check(item string) error {
+	switch t {
+	case ParamBool:
+		if _, err := strconv.ParseBool(item); err != nil {
+			return fmt.Errorf("expected a boolean, got %q", item)
+		}
+	case ParamInt:
+		if _, err := strconv.Atoi(item); err != nil {
+			return fmt.Errorf("expected an integer, got %q", item)
+		}
+	case ParamIPAddr:
+		if net.ParseIP(item) == nil {
+			return fmt.Errorf("expected an IP address, got %q", item)
+		}
+	case ParamPathList:
+		if len(item) == 0 || item[0] != '/' {
+			return fmt.Errorf("expected an absolute path, got %q", item)
+		}
+	case ParamString:
+		// any value is acceptable
+	}
+	return nil
+}
+
+// defaultParams is the subset of jail(8) parameters common enough to be
+// worth validating out of the box. RegisterParam extends this for
+// third-party and future parameters.
+var defaultParams = map[string]ParamSpec{
+	"path":             {Type: ParamPathList},
+	"name":             {Type: ParamString},
+	"host.hostname":    {Type: ParamString},
+	"host.hostuuid":    {Type: ParamString},
+	"ip4":              {Type: ParamString, Deprecated: "vnet", DeprecatedInVnet: true},
+	"ip4.addr":         {Type: ParamIPAddr, AllowList: true},
+	"ip6":              {Type: ParamString, Deprecated: "vnet", DeprecatedInVnet: true},
+	"ip6.addr":         {Type: ParamIPAddr, AllowList: true},
+	"vnet":             {Type: ParamBool},
+	"persist":          {Type: ParamBool},
+	"devfs_ruleset":    {Type: ParamInt},
+	"securelevel":      {Type: ParamInt},
+	"children.max":     {Type: ParamInt},
+	"interface":        {Type: ParamString},
+
+	"allow.mount":           {Type: ParamBool},
+	"allow.mount.devfs":     {Type: ParamBool},
+	"allow.mount.fdescfs":   {Type: ParamBool},
+	"allow.mount.procfs":    {Type: ParamBool},
+	"allow.mount.tmpfs":     {Type: ParamBool},
+	"allow.mount.zfs":       {Type: ParamBool},
+	"allow.raw_sockets":     {Type: ParamBool},
+	"allow.set_hostname":    {Type: ParamBool},
+	"allow.sysvipc":         {Type: ParamBool},
+	"allow.chflags":         {Type: ParamBool},
+	"allow.quotas":          {Type: ParamBool},
+
+	"exec.start":        {Type: ParamString},
+	"exec.stop":         {Type: ParamString},
+	"exec.prestart":     {Type: ParamString},
+	"exec.poststart":    {Type: ParamString},
+	"exec.prestop":      {Type: ParamString},
+	"exec.poststop":     {Type: ParamString},
+	"exec.clean":        {Type: ParamBool},
+	"exec.jail_user":    {Type: ParamString},
+	"exec.system_user":  {Type: ParamString},
+	"exec.system_jail_user": {Type: ParamBool},
+	"exec.timeout":      {Type: ParamInt},
+
+	"mount":          {Type: ParamBool},
+	"mount.devfs":    {Type: ParamBool},
+	"mount.fdescfs":  {Type: ParamBool},
+	"mount.procfs":   {Type: ParamBool},
+}
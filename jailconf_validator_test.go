@@ -0,0 +1,51 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import "testing"
+
+func TestValidatorStrict(t *testing.T) {
+	conf := JailConf{Entries: []JailType{
+		JailBlock{Name: "foo", Entries: []JailEntry{
+			JailKeyValuePair{Key: "made_up_param", Value: JailValueFromString("x")},
+		}},
+	}}
+
+	v := NewValidator()
+	v.Strict = true
+	if diags := v.Validate(conf); len(diags) != 1 || diags[0].Severity != SeverityError {
+		t.Fatalf("expected one strict error for an unknown parameter, got %+v", diags)
+	}
+
+	v.Strict = false
+	if diags := v.Validate(conf); len(diags) != 0 {
+		t.Fatalf("expected no diagnostics for an unknown parameter without Strict, got %+v", diags)
+	}
+}
+
+func TestValidatorPedanticIP4OnlyInVnet(t *testing.T) {
+	v := NewValidator()
+	v.Pedantic = true
+
+	vnetConf := JailConf{Entries: []JailType{
+		JailBlock{Name: "foo", Entries: []JailEntry{
+			JailKeyValuePair{Key: "vnet", Value: JailValueFromString("true")},
+			JailKeyValuePair{Key: "ip4", Value: JailValueFromString("new")},
+		}},
+	}}
+	if diags := v.Validate(vnetConf); len(diags) != 1 || diags[0].Severity != SeverityWarning {
+		t.Fatalf("expected one deprecation warning for ip4 in a vnet jail, got %+v", diags)
+	}
+
+	plainConf := JailConf{Entries: []JailType{
+		JailBlock{Name: "bar", Entries: []JailEntry{
+			JailKeyValuePair{Key: "ip4", Value: JailValueFromString("new")},
+		}},
+	}}
+	if diags := v.Validate(plainConf); len(diags) != 0 {
+		t.Fatalf("expected no warnings for ip4 outside a vnet jail, got %+v", diags)
+	}
+}
@@ -0,0 +1,295 @@
+//
+// Copyright (C) 2021, Stanislaw Adaszewski
+// See LICENSE for terms
+//
+
+package jailconf
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// includePattern matches a jail.conf(5) `.include "pattern";` directive. The
+// quoted pattern is a path or glob, resolved relative to the process's
+// working directory the same way jail(8) itself resolves it.
+var includePattern = regexp.MustCompile(`(?m)^\s*\.include\s+"([^"]+)"\s*;`)
+
+// includedFiles scans data for .include directives and returns the
+// deduplicated list of files their patterns expand to, in the order their
+// directives appear.
+func includedFiles(data []byte) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, m := range includePattern.FindAllSubmatch(data, -1) {
+		matches, err := filepath.Glob(string(m[1]))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range matches {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// WatchEvent is implemented by the concrete event types a Watcher emits:
+// JailAddedEvent, JailRemovedEvent, JailChangedEvent and
+// GlobalKeyChangedEvent.
+type WatchEvent interface {
+	isWatchEvent()
+}
+
+type JailAddedEvent struct {
+	Jail JailBlock
+}
+
+type JailRemovedEvent struct {
+	Jail JailBlock
+}
+
+type JailChangedEvent struct {
+	Old JailBlock
+	New JailBlock
+}
+
+type GlobalKeyChangedEvent struct {
+	Key string
+	Old JailValue
+	New JailValue
+}
+
+func (JailAddedEvent) isWatchEvent()       {}
+func (JailRemovedEvent) isWatchEvent()     {}
+func (JailChangedEvent) isWatchEvent()     {}
+func (GlobalKeyChangedEvent) isWatchEvent() {}
+
+// Watcher monitors a jail.conf file (and, transitively, any files pulled in
+// by its `.include` directives) for edits and emits a typed diff event for
+// every jail or global key that was added, removed or changed, so a
+// supervisor can react without re-reading and re-diffing the whole file
+// itself or shelling out to jls/jail -r.
+//
+// Events and Errors are buffered so a momentarily slow consumer doesn't
+// stall the debounce timer, but reload itself is serialized by mu: at most
+// one reload runs at a time, so a consumer that never drains Events/Errors
+// will eventually block Watcher's goroutine rather than corrupt its state.
+type Watcher struct {
+	Events chan WatchEvent
+	Errors chan error
+
+	path     string
+	debounce time.Duration
+	fsw      *fsnotify.Watcher
+	done     chan struct{}
+
+	mu       sync.Mutex
+	included map[string]bool
+	jails    map[string]JailBlock
+	globals  map[string]JailValue
+}
+
+// NewWatcher parses path once to establish the initial state, then starts
+// watching it (and any files named in its .include directives) for writes,
+// renames and recreates. Call Close when done to release the underlying
+// fsnotify watcher.
+func NewWatcher(path string) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fsw.Add(path); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	w := &Watcher{
+		Events:   make(chan WatchEvent, 16),
+		Errors:   make(chan error, 16),
+		path:     path,
+		debounce: 200 * time.Millisecond,
+		fsw:      fsw,
+		done:     make(chan struct{}),
+		included: make(map[string]bool),
+	}
+	if err := w.reload(); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching and releases the underlying fsnotify watcher.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.fsw.Close()
+}
+
+func (w *Watcher) run() {
+	var timer *time.Timer
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(w.debounce, w.onDebounce)
+			} else {
+				timer.Reset(w.debounce)
+			}
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.Errors <- err
+		}
+	}
+}
+
+func (w *Watcher) onDebounce() {
+	// editors that replace the file on save (rename-over-write) drop the
+	// inode fsnotify was watching; re-add it before diffing.
+	w.fsw.Add(w.path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.reload(); err != nil {
+		w.Errors <- err
+	}
+}
+
+// reload re-parses w.path plus any files it pulls in via .include, syncs
+// the fsnotify watch set to match, and emits a diff event for every jail
+// and global key that changed since the last reload. Callers other than
+// NewWatcher, which runs it before the watch goroutine starts, must hold
+// w.mu so overlapping debounce callbacks can't interleave their reads and
+// writes of w.jails/w.globals.
+func (w *Watcher) reload() error {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+
+	included, err := includedFiles(data)
+	if err != nil {
+		return err
+	}
+	buf := string(data)
+	for _, path := range included {
+		more, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		buf += "\n" + string(more)
+	}
+	if err := w.syncIncludes(included); err != nil {
+		return err
+	}
+
+	parser := &JailConfParser{Buffer: buf, Filename: w.path}
+	parser.Init()
+	if err := parser.Parse(); err != nil {
+		return err
+	}
+	conf, err := parser.ToStruct()
+	if err != nil {
+		return err
+	}
+
+	jails := make(map[string]JailBlock)
+	globals := make(map[string]JailValue)
+	for _, e := range conf.Entries {
+		switch entry := e.(type) {
+		case JailBlock:
+			jails[entry.Name] = entry
+		case JailKeyValuePair:
+			globals[entry.Key] = entry.Value
+		case JailKeyValueAppendPair:
+			globals[entry.Key] = globals[entry.Key].Extend(entry.Value)
+		case JailKeySet:
+			key, value := GetKeySetValue(entry.Key)
+			globals[key] = JailValueFromString(value)
+		}
+	}
+
+	// the first reload (from NewWatcher) only records the initial state.
+	if w.jails != nil {
+		w.diffJails(jails)
+		w.diffGlobals(globals)
+	}
+
+	w.jails = jails
+	w.globals = globals
+	return nil
+}
+
+// syncIncludes adds fsnotify watches for any newly-referenced include files
+// and drops watches for ones no longer referenced, so edits to a file
+// pulled in via .include trigger a reload the same as edits to w.path.
+func (w *Watcher) syncIncludes(included []string) error {
+	next := make(map[string]bool, len(included))
+	for _, path := range included {
+		next[path] = true
+		if !w.included[path] {
+			if err := w.fsw.Add(path); err != nil {
+				return err
+			}
+		}
+	}
+	for path := range w.included {
+		if !next[path] {
+			w.fsw.Remove(path)
+		}
+	}
+	w.included = next
+	return nil
+}
+
+func (w *Watcher) diffJails(jails map[string]JailBlock) {
+	for name, jblk := range jails {
+		old, existed := w.jails[name]
+		if !existed {
+			w.Events <- JailAddedEvent{Jail: jblk}
+		} else if !reflect.DeepEqual(old.Values(), jblk.Values()) {
+			w.Events <- JailChangedEvent{Old: old, New: jblk}
+		}
+	}
+	for name, jblk := range w.jails {
+		if _, stillThere := jails[name]; !stillThere {
+			w.Events <- JailRemovedEvent{Jail: jblk}
+		}
+	}
+}
+
+func (w *Watcher) diffGlobals(globals map[string]JailValue) {
+	for key, value := range globals {
+		old, existed := w.globals[key]
+		if !existed || !reflect.DeepEqual(old.Items, value.Items) {
+			w.Events <- GlobalKeyChangedEvent{Key: key, Old: old, New: value}
+		}
+	}
+	for key, value := range w.globals {
+		if _, stillThere := globals[key]; !stillThere {
+			w.Events <- GlobalKeyChangedEvent{Key: key, Old: value, New: JailValue{}}
+		}
+	}
+}